@@ -0,0 +1,58 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package packagestest
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "if true, golden files are rewritten to match actual test output")
+
+var goldenType = reflect.TypeOf((*Golden)(nil))
+
+// Golden identifies a golden master fixture used by marker driven tests to
+// check generated output against a checked in file. A marker method takes
+// a *Golden by declaring it as a parameter; the marker argument that fills
+// it in is a string naming the fixture, so a marker test can express
+// "run gofmt at this position and compare it to this golden file" as
+//    //@format("formatted.golden")
+// without any test having to hand roll the file IO itself.
+type Golden struct {
+	name string // the name of the golden fixture, as named in the marker
+}
+
+// Check compares actual against the golden fixture
+//    testdata/golden/<t.Name()>/<name>.golden
+// reporting a failure through t if they differ.
+// If the -update flag was passed to the test binary, the golden file is
+// rewritten to match actual instead of being compared against it.
+func (g *Golden) Check(t *testing.T, actual []byte) {
+	t.Helper()
+	name := strings.TrimSuffix(g.name, ".golden") + ".golden"
+	path := filepath.Join("testdata", "golden", t.Name(), name)
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatalf("Could not create golden directory %v: %v", filepath.Dir(path), err)
+		}
+		if err := ioutil.WriteFile(path, actual, 0666); err != nil {
+			t.Fatalf("Could not write golden file %v: %v", path, err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Could not read golden file %v: %v", path, err)
+	}
+	if !bytes.Equal(want, actual) {
+		t.Errorf("%s does not match golden file %s\ngot:\n%s\nwant:\n%s", g.name, path, actual, want)
+	}
+}
@@ -12,20 +12,69 @@ import (
 	"go/printer"
 	"go/token"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
-	markerComment = []byte("//@")
-	testingType   = reflect.TypeOf((*testing.T)(nil))
-	markersType   = reflect.TypeOf((*Markers)(nil))
-	positionType  = reflect.TypeOf(Position{})
+	markerSuffix = []byte("@")
+	testingType  = reflect.TypeOf((*testing.T)(nil))
+	markersType  = reflect.TypeOf((*Markers)(nil))
+	markerType   = reflect.TypeOf((*marker)(nil))
+	positionType = reflect.TypeOf(Position{})
+	rangeType    = reflect.TypeOf(Range{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	regexpType   = reflect.TypeOf((*regexp.Regexp)(nil))
+	exprType     = reflect.TypeOf((*ast.Expr)(nil)).Elem()
 )
 
+// commentSyntax maps a file extension (including the leading dot) to the
+// line comment prefix used to recognize markers in files of that kind.
+// It only holds extensions a caller has explicitly vouched for, either
+// built in here or added with RegisterLineComment; ExtractAll relies on
+// that to decide which files in a directory tree are worth reading, so an
+// extensionless file is only swept in if "" has itself been registered.
+var commentSyntax = map[string][]byte{
+	".go":  []byte("//"),
+	".mod": []byte("//"),
+	".s":   []byte("//"),
+}
+
+// defaultLineComment is the prefix Extract falls back to when asked to
+// read a file whose extension has no entry in commentSyntax. Since the
+// caller named that file explicitly, guessing a shell-style comment is
+// reasonable in a way that sweeping every extensionless file found by
+// ExtractAll would not be.
+var defaultLineComment = []byte("#")
+
+// RegisterLineComment registers the line comment prefix used to recognize
+// markers in files with the given extension (which must include the
+// leading dot, for instance ".py"). It is only safe to call this before
+// Extract or ExtractAll are called.
+func RegisterLineComment(extension, prefix string) {
+	commentSyntax[extension] = []byte(prefix)
+}
+
+// lineComment returns the full marker comment (line comment prefix plus the
+// "@" that introduces a marker) to look for in filename, based on its
+// extension.
+func lineComment(filename string) []byte {
+	prefix, ok := commentSyntax[filepath.Ext(filename)]
+	if !ok {
+		prefix = defaultLineComment
+	}
+	comment := make([]byte, 0, len(prefix)+len(markerSuffix))
+	comment = append(comment, prefix...)
+	return append(comment, markerSuffix...)
+}
+
 // Markers collects and then invokes a set of marker expressions in go source
 // code.
 // This is intended for use in tests that manipulate go code and have to care
@@ -43,11 +92,33 @@ type Position struct {
 	Offset int
 }
 
+// Range represents a span between two positions within a source file.
+// A marker argument is coerced to a Range either from a backtick pattern,
+// matched against the marker's own line like a Position, or from the
+// explicit form span(start, end), where start and end are themselves
+// arguments that convert to Position (an anchor name or a pattern). The
+// form is spelled span(...) rather than range(...) because range is a Go
+// keyword and cannot appear as a call identifier in a marker expression.
+type Range struct {
+	Start Position
+	End   Position
+}
+
 // marker is the internal representation of a marker within a source file
 type marker struct {
-	line   *line      // the line on which the marker occurred
-	method string     // the method the marker invokes
-	args   []ast.Expr // the arguments to pass to that method
+	line   *line                       // the line on which the marker occurred
+	column int                         // 1 based column of the marker expression on that line, just after the comment prefix and @
+	method string                      // the method the marker invokes
+	args   []ast.Expr                  // the arguments to pass to that method
+	cache  map[ast.Expr]*regexp.Regexp // memoized regexps compiled from this marker's arguments
+}
+
+// fatalf reports a fatal test failure at the marker's own position
+// (file:line:col) in the source under test, rather than the position
+// inside packagestest that detected the problem.
+func (a *marker) fatalf(t *testing.T, format string, args ...interface{}) {
+	t.Helper()
+	t.Fatalf("%s:%d:%d: %s", a.line.file.name, a.line.number, a.column, fmt.Sprintf(format, args...))
 }
 
 // line represents a single line within a source file
@@ -62,6 +133,7 @@ type line struct {
 type file struct {
 	name    string // the name of the file, often its actual full path on disk
 	content []byte // the contents of the file
+	scope   string // the name other files can use to refer to this file's anchors, if any
 }
 
 // converter from a marker arguments parsed from the comment to reflect values
@@ -79,6 +151,9 @@ type method struct {
 // This should only be called before the first call to Invoke.
 // Markers are a special comment that starts with //@ where the text of the
 // comment is parsed as go expressions.
+// The comment prefix before the @ depends on the extension of filename; by
+// default it is // for .go, .mod and .s files and # for anything else, but
+// more extensions can be taught to Extract with RegisterLineComment.
 // When the comment body is an identifier, it is treated as syntactic sugar for
 // the very common case of declaring an anchor of the same name as the matched
 // string. So for instanced
@@ -99,19 +174,49 @@ type method struct {
 // expression to match against the current line, and the position will be the
 // one at the start of the pattern match.
 func (m *Markers) Extract(filename string, content []byte) error {
-	f := &file{name: filename, content: content}
+	return m.extract("", filename, content)
+}
+
+// File scopes marker extraction to a single named file within a Markers set.
+type File struct {
+	markers *Markers
+	scope   string
+}
+
+// File returns a handle that extracts markers from a single file into m,
+// recording the file's anchors under scope.AnchorName instead of their bare
+// names, so that markers in any file extracted into m can refer to them
+// unambiguously as scope.AnchorName (a selector expression resolved by the
+// Position converter in buildConverter). This resolves the ambiguity that
+// otherwise arises when two files extracted into the same Markers declare
+// an anchor with the same name. A bare AnchorName does not resolve to an
+// anchor declared in a scoped file, not even from within that file.
+func (m *Markers) File(scope string) *File {
+	return &File{markers: m, scope: scope}
+}
+
+// Extract behaves like Markers.Extract, but anchors declared while
+// extracting filename are recorded under the file's scope name, as
+// scope.AnchorName, rather than under their bare names.
+func (f *File) Extract(filename string, content []byte) error {
+	return f.markers.extract(f.scope, filename, content)
+}
+
+func (m *Markers) extract(scope, filename string, content []byte) error {
+	f := &file{name: filename, content: content, scope: scope}
 	if f.content == nil {
 		var err error
 		if f.content, err = ioutil.ReadFile(f.name); err != nil {
 			return fmt.Errorf("Could not read test file: %v", err)
 		}
 	}
+	comment := lineComment(filename)
 	offset := 0
 	// iterate over all the lines
 	// we presume that all source files are small enough to fit in memory easily
 	for n, lValue := range bytes.SplitAfter(f.content, []byte("\n")) {
 		// split on the special comment markers
-		parts := bytes.Split(lValue, markerComment)
+		parts := bytes.Split(lValue, comment)
 		l := &line{
 			file:   f,
 			number: n + 1,
@@ -119,7 +224,10 @@ func (m *Markers) Extract(filename string, content []byte) error {
 			offset: offset,
 		}
 		offset += len(lValue)
+		consumed := len(parts[0])
 		for _, part := range parts[1:] {
+			col := consumed + len(comment) + 1
+			consumed += len(comment) + len(part)
 
 			body := strings.TrimSpace(string(part))
 			expr, err := parser.ParseExpr(body)
@@ -133,13 +241,13 @@ func (m *Markers) Extract(filename string, content []byte) error {
 					Kind:     token.STRING,
 					Value:    strconv.Quote(expr.Name),
 				}
-				m.markers = append(m.markers, &marker{method: "mark", args: []ast.Expr{expr, s}, line: l})
+				m.markers = append(m.markers, &marker{method: "mark", args: []ast.Expr{expr, s}, line: l, column: col})
 			case *ast.CallExpr:
 				name, ok := expr.Fun.(*ast.Ident)
 				if !ok {
 					return fmt.Errorf("Function must be an identifier, got %T in %s at %v", expr.Fun, body, l)
 				}
-				m.markers = append(m.markers, &marker{method: name.Name, args: expr.Args, line: l})
+				m.markers = append(m.markers, &marker{method: name.Name, args: expr.Args, line: l, column: col})
 			default:
 				return fmt.Errorf("Unhandled marker expression type %T in %s at %v", expr, body, l)
 			}
@@ -148,6 +256,37 @@ func (m *Markers) Extract(filename string, content []byte) error {
 	return nil
 }
 
+// ExtractAll walks the directory tree rooted at dir and calls Extract on
+// every file whose extension has a registered line comment syntax (see
+// RegisterLineComment), skipping any file types it does not recognize.
+// This allows a single marker set to span a testdata tree made up of
+// multiple file kinds, such as .go sources alongside a go.mod.
+// This should only be called before the first call to Invoke.
+func (m *Markers) ExtractAll(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		if _, ok := commentSyntax[filepath.Ext(path)]; !ok {
+			return nil
+		}
+		return m.Extract(path, nil)
+	})
+}
+
+// NOTE: this package does not yet provide Markers.ExtractModule, which would
+// walk every file of every module in a packagestest.Export fixture (scoping
+// each module's files under its name via Markers.File, with filenames
+// resolved through the fixture's on-disk paths) so a single Invoke could
+// drive a tool across a realistic multi-module workspace. It depends on the
+// real packagestest.Exported type (produced by Export, with a
+// File(module, fragment string) string method), which is not present in
+// this snapshot; add ExtractModule against that method once it is, rather
+// than against a fabricated stand-in with an incompatible shape.
+
 // Anchors returns the set of anchors that were present in the files processed.
 // It is not safe to add any more files after this method has been called.
 // Anchors are declared with either the
@@ -160,18 +299,37 @@ func (m *Markers) Anchors(t *testing.T) map[string]Position {
 		// no anchors yet, pre invoke the special mark marker.
 		m.anchors = make(map[string]Position)
 		m.Invoke(t, map[string]interface{}{
-			"mark": func(t *testing.T, m *Markers, name string, pos Position) {
-				if old, found := m.anchors[name]; found {
-					t.Errorf("Anchor %v already exists at %v, found %v", name, old, pos)
+			"mark": func(t *testing.T, m *Markers, mk *marker, name string, pos Position) {
+				key := name
+				if scope := mk.line.file.scope; scope != "" {
+					key = scope + "." + name
+				}
+				if old, found := m.anchors[key]; found {
+					t.Errorf("Anchor %v already exists at %v, found %v", key, old, pos)
 					return
 				}
-				m.anchors[name] = pos
+				m.anchors[key] = pos
 			},
 		})
 	}
 	return m.anchors
 }
 
+// order sorts the collected markers into the documented, deterministic
+// order: by filename, then by byte offset of the marker comment within
+// that file. This makes Invoke (and so Anchors) independent of the order
+// in which Extract was called, and groups each file's markers into a
+// contiguous run for InvokeParallel.
+func (m *Markers) order() {
+	sort.SliceStable(m.markers, func(i, j int) bool {
+		fi, fj := m.markers[i].line.file.name, m.markers[j].line.file.name
+		if fi != fj {
+			return fi < fj
+		}
+		return m.markers[i].line.offset+m.markers[i].column < m.markers[j].line.offset+m.markers[j].column
+	})
+}
+
 // Invoke is called to evaluate the markers found.
 // It is passed the methods, which will be bound by name to the marker functions being
 // invoked.
@@ -179,18 +337,66 @@ func (m *Markers) Anchors(t *testing.T) map[string]Position {
 // It is not safe to add any more files after this method has been called.
 // It is safe to all this as many times as you like, and you can repeat the same method name with
 // a different implementation if you like.
+// Markers are invoked in the order documented for order: by filename, then
+// by position within the file.
 func (m *Markers) Invoke(t *testing.T, methods map[string]interface{}) {
 	m.Anchors(t) // Make sure we have collected the anchors so we can refer to them by name
+	m.order()
+	m.invoke(t, methods, m.markers)
+}
+
+// InvokeParallel is like Invoke, but groups the markers by the file they
+// were found in, and runs each file's group as its own parallel subtest
+// using t.Run and t.Parallel. This lets large marker test suites, with
+// markers spread across hundreds of testdata files, run concurrently with
+// failures isolated to the file that caused them. Marker methods that take
+// a *testing.T or *Markers receive the subtest's *testing.T, not t itself.
+func (m *Markers) InvokeParallel(t *testing.T, methods map[string]interface{}) {
+	m.Anchors(t)
+	m.order()
+	for _, group := range m.groupByFile() {
+		group := group
+		t.Run(group.filename, func(t *testing.T) {
+			t.Parallel()
+			m.invoke(t, methods, group.markers)
+		})
+	}
+}
+
+// fileGroup is a contiguous run of markers that all came from the same file.
+type fileGroup struct {
+	filename string
+	markers  []*marker
+}
+
+// groupByFile splits m.markers, which must already be ordered by order,
+// into one fileGroup per distinct source file.
+func (m *Markers) groupByFile() []fileGroup {
+	var groups []fileGroup
+	for _, a := range m.markers {
+		name := a.line.file.name
+		if len(groups) == 0 || groups[len(groups)-1].filename != name {
+			groups = append(groups, fileGroup{filename: name})
+		}
+		last := &groups[len(groups)-1]
+		last.markers = append(last.markers, a)
+	}
+	return groups
+}
+
+// invoke evaluates markers against the given methods, using t both to
+// build converters and to invoke the bound methods.
+func (m *Markers) invoke(t *testing.T, methods map[string]interface{}, markers []*marker) {
 	ms := make(map[string]method, len(methods))
 	for name, f := range methods {
 		mi := method{f: reflect.ValueOf(f)}
 		mi.converters = make([]converter, mi.f.Type().NumIn())
 		for i := 0; i < len(mi.converters); i++ {
-			mi.converters[i] = m.buildConverter(t, mi.f.Type().In(i))
+			mi.converters[i] = m.buildConverter(t, mi.f.Type().In(i), i == len(mi.converters)-1)
 		}
 		ms[name] = mi
 	}
-	for _, a := range m.markers {
+	for _, a := range markers {
 		mi, ok := ms[a.method]
 		if !ok {
 			continue
@@ -201,7 +407,7 @@ func (m *Markers) Invoke(t *testing.T, methods map[string]interface{}) {
 			params[i], args = convert(t, a, args)
 		}
 		if len(args) > 0 {
-			t.Fatalf("Unwanted args got %+v extra to %v", sprintArgs(args...), a)
+			a.fatalf(t, "Unwanted args got %+v extra to %v", sprintArgs(args...), a)
 		}
 		mi.f.Call(params)
 	}
@@ -211,7 +417,10 @@ func (m *Markers) Invoke(t *testing.T, methods map[string]interface{}) {
 // value of the type expected by a method.
 // It is called when only the target type is know, it returns converters that are flexible across
 // all supported expression types for that target type.
-func (m *Markers) buildConverter(t *testing.T, pt reflect.Type) converter {
+// last reports whether pt is the type of the method's final parameter; it is
+// only consulted by the []string converter, which may only greedily consume
+// every remaining argument when there is nothing left to convert afterwards.
+func (m *Markers) buildConverter(t *testing.T, pt reflect.Type, last bool) converter {
 	switch {
 	case pt == testingType:
 		return func(t *testing.T, a *marker, args []ast.Expr) (reflect.Value, []ast.Expr) {
@@ -221,10 +430,14 @@ func (m *Markers) buildConverter(t *testing.T, pt reflect.Type) converter {
 		return func(t *testing.T, a *marker, args []ast.Expr) (reflect.Value, []ast.Expr) {
 			return reflect.ValueOf(m), args
 		}
+	case pt == markerType:
+		return func(t *testing.T, a *marker, args []ast.Expr) (reflect.Value, []ast.Expr) {
+			return reflect.ValueOf(a), args
+		}
 	case pt == positionType:
 		return func(t *testing.T, a *marker, args []ast.Expr) (reflect.Value, []ast.Expr) {
 			if len(args) < 1 {
-				t.Fatalf("Missing argument for %v", a)
+				a.fatalf(t, "Missing argument for %v", a)
 			}
 			arg := args[0]
 			args = args[1:]
@@ -233,40 +446,45 @@ func (m *Markers) buildConverter(t *testing.T, pt reflect.Type) converter {
 				// look up an anchor by name
 				p, ok := m.anchors[arg.Name]
 				if !ok {
-					t.Fatalf("Cannot find anchor %v for %v", arg.Name, a)
+					a.fatalf(t, "Cannot find anchor %v for %v", arg.Name, a)
+				}
+				return reflect.ValueOf(p), args
+			case *ast.SelectorExpr:
+				// look up an anchor declared in another file, as scope.Anchor
+				// (see Markers.File)
+				scope, ok := arg.X.(*ast.Ident)
+				if !ok {
+					a.fatalf(t, "Cannot convert %s to position for %v", sprintArgs(arg), a)
+				}
+				name := scope.Name + "." + arg.Sel.Name
+				p, ok := m.anchors[name]
+				if !ok {
+					a.fatalf(t, "Cannot find anchor %v for %v", name, a)
 				}
 				return reflect.ValueOf(p), args
 			case *ast.BasicLit:
 				s, err := strconv.Unquote(arg.Value)
 				if err != nil {
-					t.Fatalf("Invalid string literal %v for %v", arg.Value, a)
-				}
-				p := Position{
-					Position: token.Position{
-						Filename: a.line.file.name,
-						Line:     a.line.number,
-					},
+					a.fatalf(t, "Invalid string literal %v for %v", arg.Value, a)
 				}
 				i := -1
 				if arg.Value[0] == '`' {
 					re, err := regexp.Compile(s)
 					if err != nil {
-						t.Fatalf("%v in %v", err, a.line)
+						a.fatalf(t, "%v in %v", err, a.line)
 					}
-					if m := re.FindIndex(a.line.value); m != nil {
-						i = m[0]
+					if start, _, ok := findPattern(a.line, re); ok {
+						i = start
 					}
 				} else {
 					i = bytes.Index(a.line.value, []byte(s))
 				}
 				if i < 0 {
-					t.Fatalf("Pattern %v was not present in line %v", s, a.line)
+					a.fatalf(t, "Pattern %v was not present in line %v", s, a.line)
 				}
-				p.Offset = a.line.offset + i
-				p.Column = len(string(a.line.value[:i])) + 1
-				return reflect.ValueOf(p), args
+				return reflect.ValueOf(positionAt(a.line, i)), args
 			default:
-				t.Fatalf("Cannot convert %s to position for %v", sprintArgs(arg), a)
+				a.fatalf(t, "Cannot convert %s to position for %v", sprintArgs(arg), a)
 				panic("unreachable")
 			}
 		}
@@ -279,15 +497,15 @@ func (m *Markers) buildConverter(t *testing.T, pt reflect.Type) converter {
 				return reflect.ValueOf(arg.Name), args
 			case *ast.BasicLit:
 				if arg.Kind != token.STRING {
-					t.Fatalf("Non string literal %v", sprintArgs(arg))
+					a.fatalf(t, "Non string literal %v", sprintArgs(arg))
 				}
 				s, err := strconv.Unquote(arg.Value)
 				if err != nil {
-					t.Fatalf("Invalid string literal %v", arg.Value)
+					a.fatalf(t, "Invalid string literal %v", arg.Value)
 				}
 				return reflect.ValueOf(s), args
 			default:
-				t.Fatalf("Cannot convert %v to string", sprintArgs(arg))
+				a.fatalf(t, "Cannot convert %v to string", sprintArgs(arg))
 				panic("unreachable")
 			}
 		}
@@ -297,23 +515,239 @@ func (m *Markers) buildConverter(t *testing.T, pt reflect.Type) converter {
 			args = args[1:]
 			lit, ok := arg.(*ast.BasicLit)
 			if !ok {
-				t.Fatalf("Integer args must be a literal, got %v", sprintArgs(arg))
+				a.fatalf(t, "Integer args must be a literal, got %v", sprintArgs(arg))
 			}
 			if lit.Kind != token.INT {
-				t.Fatalf("Non integer literal %v", sprintArgs(arg))
+				a.fatalf(t, "Non integer literal %v", sprintArgs(arg))
 			}
 			v, err := strconv.Atoi(lit.Value)
 			if err != nil {
-				t.Fatalf("Cannot convert %v to int: %v", sprintArgs(arg), err)
+				a.fatalf(t, "Cannot convert %v to int: %v", sprintArgs(arg), err)
 			}
 			return reflect.ValueOf(v), args
 		}
+	case pt.Kind() == reflect.Bool:
+		return func(t *testing.T, a *marker, args []ast.Expr) (reflect.Value, []ast.Expr) {
+			if len(args) < 1 {
+				a.fatalf(t, "Missing argument for %v", a)
+			}
+			arg := args[0]
+			args = args[1:]
+			ident, ok := arg.(*ast.Ident)
+			if !ok || (ident.Name != "true" && ident.Name != "false") {
+				a.fatalf(t, "Cannot convert %v to bool", sprintArgs(arg))
+			}
+			return reflect.ValueOf(ident.Name == "true"), args
+		}
+	case pt.Kind() == reflect.Float64:
+		return func(t *testing.T, a *marker, args []ast.Expr) (reflect.Value, []ast.Expr) {
+			if len(args) < 1 {
+				a.fatalf(t, "Missing argument for %v", a)
+			}
+			arg := args[0]
+			args = args[1:]
+			lit, ok := arg.(*ast.BasicLit)
+			if !ok || (lit.Kind != token.FLOAT && lit.Kind != token.INT) {
+				a.fatalf(t, "Float args must be a numeric literal, got %v", sprintArgs(arg))
+			}
+			v, err := strconv.ParseFloat(lit.Value, 64)
+			if err != nil {
+				a.fatalf(t, "Cannot convert %v to float64: %v", sprintArgs(arg), err)
+			}
+			return reflect.ValueOf(v), args
+		}
+	case pt.Kind() == reflect.Slice && pt.Elem().Kind() == reflect.String:
+		return func(t *testing.T, a *marker, args []ast.Expr) (reflect.Value, []ast.Expr) {
+			// A single composite literal such as []string{"a", "b"} gives the
+			// slice contents directly, and may be followed by further
+			// arguments for the method's remaining parameters.
+			if len(args) > 0 {
+				if lit, ok := args[0].(*ast.CompositeLit); ok {
+					items := make([]string, len(lit.Elts))
+					for i, elt := range lit.Elts {
+						bl, ok := elt.(*ast.BasicLit)
+						if !ok || bl.Kind != token.STRING {
+							a.fatalf(t, "Non string literal %v in %v", sprintArgs(elt), a)
+						}
+						s, err := strconv.Unquote(bl.Value)
+						if err != nil {
+							a.fatalf(t, "Invalid string literal %v: %v", bl.Value, err)
+						}
+						items[i] = s
+					}
+					return reflect.ValueOf(items), args[1:]
+				}
+			}
+			// Otherwise, every remaining argument is consumed as a string,
+			// so a bare (non-composite-literal) []string parameter must be
+			// the last one declared on the method.
+			if !last {
+				a.fatalf(t, "A []string parameter must be the last parameter unless given as a composite literal, in %v", a)
+			}
+			strConv := m.buildConverter(t, reflect.TypeOf(""), true)
+			items := make([]string, 0, len(args))
+			for len(args) > 0 {
+				var v reflect.Value
+				v, args = strConv(t, a, args)
+				items = append(items, v.String())
+			}
+			return reflect.ValueOf(items), args
+		}
+	case pt == durationType:
+		return func(t *testing.T, a *marker, args []ast.Expr) (reflect.Value, []ast.Expr) {
+			if len(args) < 1 {
+				a.fatalf(t, "Missing argument for %v", a)
+			}
+			arg := args[0]
+			args = args[1:]
+			lit, ok := arg.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				a.fatalf(t, "Duration args must be a string literal, got %v", sprintArgs(arg))
+			}
+			s, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				a.fatalf(t, "Invalid string literal %v: %v", lit.Value, err)
+			}
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				a.fatalf(t, "Cannot convert %v to time.Duration: %v", s, err)
+			}
+			return reflect.ValueOf(d), args
+		}
+	case pt == regexpType:
+		return func(t *testing.T, a *marker, args []ast.Expr) (reflect.Value, []ast.Expr) {
+			if len(args) < 1 {
+				a.fatalf(t, "Missing argument for %v", a)
+			}
+			arg := args[0]
+			args = args[1:]
+			lit, ok := arg.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING || lit.Value[0] != '`' {
+				a.fatalf(t, "Regexp args must be a backtick literal, got %v", sprintArgs(arg))
+			}
+			if re, ok := a.cache[arg]; ok {
+				return reflect.ValueOf(re), args
+			}
+			s, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				a.fatalf(t, "Invalid regexp literal %v: %v", lit.Value, err)
+			}
+			re, err := regexp.Compile(s)
+			if err != nil {
+				a.fatalf(t, "Invalid regexp %v: %v", s, err)
+			}
+			if a.cache == nil {
+				a.cache = make(map[ast.Expr]*regexp.Regexp)
+			}
+			a.cache[arg] = re
+			return reflect.ValueOf(re), args
+		}
+	case pt == rangeType:
+		return func(t *testing.T, a *marker, args []ast.Expr) (reflect.Value, []ast.Expr) {
+			if len(args) < 1 {
+				a.fatalf(t, "Missing argument for %v", a)
+			}
+			arg := args[0]
+			args = args[1:]
+			switch arg := arg.(type) {
+			case *ast.CallExpr:
+				// "range" is a go keyword and cannot appear as a call
+				// identifier in a parsed expression, so the span between
+				// two positions is spelled span(start, end) instead.
+				name, ok := arg.Fun.(*ast.Ident)
+				if !ok || name.Name != "span" || len(arg.Args) != 2 {
+					a.fatalf(t, "Range must be span(start, end), got %v", sprintArgs(arg))
+				}
+				posConv := m.buildConverter(t, positionType, false)
+				startV, rest := posConv(t, a, arg.Args)
+				endV, rest := posConv(t, a, rest)
+				if len(rest) != 0 {
+					a.fatalf(t, "range takes exactly two positions, got %v", sprintArgs(arg.Args...))
+				}
+				return reflect.ValueOf(Range{
+					Start: startV.Interface().(Position),
+					End:   endV.Interface().(Position),
+				}), args
+			case *ast.BasicLit:
+				if arg.Kind != token.STRING || arg.Value[0] != '`' {
+					a.fatalf(t, "Range literal must be a backtick pattern, got %v", sprintArgs(arg))
+				}
+				s, err := strconv.Unquote(arg.Value)
+				if err != nil {
+					a.fatalf(t, "Invalid regexp literal %v: %v", arg.Value, err)
+				}
+				re, err := regexp.Compile(s)
+				if err != nil {
+					a.fatalf(t, "%v in %v", err, a.line)
+				}
+				start, end, ok := findPattern(a.line, re)
+				if !ok {
+					a.fatalf(t, "Pattern %v was not present in line %v", s, a.line)
+				}
+				return reflect.ValueOf(Range{
+					Start: positionAt(a.line, start),
+					End:   positionAt(a.line, end),
+				}), args
+			default:
+				a.fatalf(t, "Cannot convert %s to range for %v", sprintArgs(arg), a)
+				panic("unreachable")
+			}
+		}
+	case pt == exprType:
+		return func(t *testing.T, a *marker, args []ast.Expr) (reflect.Value, []ast.Expr) {
+			if len(args) < 1 {
+				a.fatalf(t, "Missing argument for %v", a)
+			}
+			v := reflect.New(exprType).Elem()
+			v.Set(reflect.ValueOf(args[0]))
+			return v, args[1:]
+		}
+	case pt == goldenType:
+		return func(t *testing.T, a *marker, args []ast.Expr) (reflect.Value, []ast.Expr) {
+			if len(args) < 1 {
+				a.fatalf(t, "Missing argument for %v", a)
+			}
+			arg := args[0]
+			args = args[1:]
+			lit, ok := arg.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				a.fatalf(t, "Golden args must be a string literal, got %v", sprintArgs(arg))
+			}
+			s, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				a.fatalf(t, "Invalid string literal %v: %v", lit.Value, err)
+			}
+			return reflect.ValueOf(&Golden{name: s}), args
+		}
 	default:
 		t.Fatalf("Action param has invalid type %v(%T)", pt, pt)
 		panic("unreachable")
 	}
 }
 
+// positionAt builds the Position for the byte offset within l.
+func positionAt(l *line, offset int) Position {
+	p := Position{
+		Position: token.Position{
+			Filename: l.file.name,
+			Line:     l.number,
+		},
+		Offset: l.offset + offset,
+	}
+	p.Column = len(string(l.value[:offset])) + 1
+	return p
+}
+
+// findPattern returns the start and end byte offsets of the first match of
+// re within l, and false if there was no match.
+func findPattern(l *line, re *regexp.Regexp) (start, end int, ok bool) {
+	loc := re.FindIndex(l.value)
+	if loc == nil {
+		return 0, 0, false
+	}
+	return loc[0], loc[1], true
+}
+
 // sprintArgs is a small helper for pretty printing the ast expression list in error messages.
 func sprintArgs(args ...ast.Expr) string {
 	fset := token.NewFileSet()
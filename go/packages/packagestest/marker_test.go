@@ -6,11 +6,19 @@ package packagestest_test
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
+	"go/format"
 	"go/token"
 	"io/ioutil"
 	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 
 	"golang.org/x/tools/go/packages/packagestest"
 )
@@ -115,3 +123,255 @@ func TestMarker(t *testing.T) {
 		}
 	}
 }
+
+func TestTypes(t *testing.T) {
+	const filename = "testdata/types.go"
+	markers := packagestest.Markers{}
+	if err := markers.Extract(filename, nil); err != nil {
+		t.Fatalf("Failed to extract markers: %v", err)
+	}
+	var (
+		gotBool           bool
+		gotFloat          float64
+		gotDuration       time.Duration
+		gotWords          []string
+		gotPattern        *regexp.Regexp
+		gotRanges         = map[string]packagestest.Range{}
+		gotWordsThenBool  []string
+		gotFlagAfterWords bool
+	)
+	markers.Invoke(t, map[string]interface{}{
+		"printBool":          func(name string, v bool) { gotBool = v },
+		"printFloat":         func(name string, v float64) { gotFloat = v },
+		"printDuration":      func(name string, v time.Duration) { gotDuration = v },
+		"printWords":         func(name string, v []string) { gotWords = v },
+		"printPattern":       func(name string, v *regexp.Regexp) { gotPattern = v },
+		"printRange":         func(name string, v packagestest.Range) { gotRanges[name] = v },
+		"printWordsThenBool": func(name string, words []string, flag bool) { gotWordsThenBool = words; gotFlagAfterWords = flag },
+	})
+	if !gotBool {
+		t.Errorf("Expected bool true, got %v", gotBool)
+	}
+	if gotFloat != 3.14 {
+		t.Errorf("Expected float 3.14, got %v", gotFloat)
+	}
+	if gotDuration != 1500*time.Millisecond {
+		t.Errorf("Expected duration 1500ms, got %v", gotDuration)
+	}
+	if strings.Join(gotWords, ",") != "un,deux,trois" {
+		t.Errorf("Expected words [un deux trois], got %v", gotWords)
+	}
+	if gotPattern == nil || !gotPattern.MatchString("Hello, world") {
+		t.Errorf("Expected pattern matching %q, got %v", "Hello, world", gotPattern)
+	}
+	explicit, pattern := gotRanges["ExplicitRange"], gotRanges["PatternRange"]
+	if explicit.Start.Offset >= explicit.End.Offset {
+		t.Errorf("Expected ExplicitRange to span forward, got %v", explicit)
+	}
+	if pattern.Start.Offset >= pattern.End.Offset {
+		t.Errorf("Expected PatternRange to span forward, got %v", pattern)
+	}
+	if strings.Join(gotWordsThenBool, ",") != "un,deux" {
+		t.Errorf("Expected words [un deux], got %v", gotWordsThenBool)
+	}
+	if !gotFlagAfterWords {
+		t.Errorf("Expected flag after a composite literal []string to still be read, got %v", gotFlagAfterWords)
+	}
+}
+
+func TestCrossFile(t *testing.T) {
+	markers := packagestest.Markers{}
+	if err := markers.File("a").Extract("testdata/crossfile/a.go", nil); err != nil {
+		t.Fatalf("Failed to extract markers: %v", err)
+	}
+	if err := markers.File("b").Extract("testdata/crossfile/b.go", nil); err != nil {
+		t.Fatalf("Failed to extract markers: %v", err)
+	}
+	var got packagestest.Position
+	markers.Invoke(t, map[string]interface{}{
+		"checkCross": func(name string, pos packagestest.Position) { got = pos },
+	})
+	anchors := markers.Anchors(t)
+	want, ok := anchors["a.AnchorA"]
+	if !ok {
+		t.Fatalf("Expected scoped anchor a.AnchorA is missing")
+	}
+	if got != want {
+		t.Errorf("Got %v expected %v", got, want)
+	}
+}
+
+func TestScopedAnchorCollision(t *testing.T) {
+	markers := packagestest.Markers{}
+	if err := markers.File("a").Extract("testdata/scoped/a.go", nil); err != nil {
+		t.Fatalf("Failed to extract markers: %v", err)
+	}
+	if err := markers.File("b").Extract("testdata/scoped/b.go", nil); err != nil {
+		t.Fatalf("Failed to extract markers: %v", err)
+	}
+	anchors := markers.Anchors(t)
+	a, ok := anchors["a.Shared"]
+	if !ok {
+		t.Fatalf("Expected scoped anchor a.Shared is missing")
+	}
+	b, ok := anchors["b.Shared"]
+	if !ok {
+		t.Fatalf("Expected scoped anchor b.Shared is missing")
+	}
+	if a == b {
+		t.Errorf("a.Shared and b.Shared resolved to the same position %v", a)
+	}
+}
+
+func TestInvokeParallel(t *testing.T) {
+	markers := packagestest.Markers{}
+	// Extract out of order, to check that InvokeParallel's grouping does not
+	// depend on extraction order.
+	if err := markers.File("b").Extract("testdata/crossfile/b.go", nil); err != nil {
+		t.Fatalf("Failed to extract markers: %v", err)
+	}
+	if err := markers.File("a").Extract("testdata/crossfile/a.go", nil); err != nil {
+		t.Fatalf("Failed to extract markers: %v", err)
+	}
+	wantFile := map[string]string{"A": "a.go", "B": "b.go"}
+	markers.InvokeParallel(t, map[string]interface{}{
+		"record": func(t *testing.T, name string) {
+			if want := wantFile[name]; !strings.HasSuffix(t.Name(), want) {
+				t.Errorf("record %s ran in subtest %s, wanted suffix %s", name, t.Name(), want)
+			}
+		},
+		"checkCross": func(t *testing.T, name string, pos packagestest.Position) {
+			if !strings.HasSuffix(t.Name(), "b.go") {
+				t.Errorf("checkCross ran in subtest %s, wanted suffix b.go", t.Name())
+			}
+		},
+	})
+}
+
+func TestGolden(t *testing.T) {
+	const filename = "testdata/golden_fixture.go"
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("Could not read test file %v: %v", filename, err)
+	}
+	formatted, err := format.Source(content)
+	if err != nil {
+		t.Fatalf("Could not gofmt %v: %v", filename, err)
+	}
+	markers := packagestest.Markers{}
+	if err := markers.Extract(filename, nil); err != nil {
+		t.Fatalf("Failed to extract markers: %v", err)
+	}
+	markers.Invoke(t, map[string]interface{}{
+		"format": func(g *packagestest.Golden) {
+			g.Check(t, formatted)
+		},
+	})
+}
+
+// TestGoldenMismatch checks that Golden.Check reports a failure when the
+// actual output does not match the checked in golden file. It has to
+// observe that failure in a child process, re-exec'd with an environment
+// variable that tells it to run the actual mismatching check, since
+// there's no other way to see a *testing.T failure without failing the
+// test that caused it.
+func TestGoldenMismatch(t *testing.T) {
+	if os.Getenv("PACKAGESTEST_GOLDEN_MISMATCH_CHILD") == "1" {
+		const filename = "testdata/golden_mismatch_fixture.go"
+		markers := packagestest.Markers{}
+		if err := markers.Extract(filename, nil); err != nil {
+			t.Fatalf("Failed to extract markers: %v", err)
+		}
+		markers.Invoke(t, map[string]interface{}{
+			"format": func(g *packagestest.Golden) {
+				g.Check(t, []byte("this does not match the checked in golden file\n"))
+			},
+		})
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestGoldenMismatch$")
+	cmd.Env = append(os.Environ(), "PACKAGESTEST_GOLDEN_MISMATCH_CHILD=1")
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatalf("Expected Check to fail on a golden mismatch, but the child test passed:\n%s", out)
+	}
+	if !bytes.Contains(out, []byte("does not match golden file")) {
+		t.Fatalf("Expected a golden mismatch error in the child test output, got:\n%s", out)
+	}
+}
+
+// TestGoldenUpdate checks that Golden.Check rewrites the golden file to
+// match actual when the -update flag is set, rather than comparing
+// against it.
+func TestGoldenUpdate(t *testing.T) {
+	path := filepath.Join("testdata", "golden", t.Name(), "update.golden")
+	t.Cleanup(func() { os.RemoveAll(filepath.Dir(path)) })
+
+	if err := flag.Set("update", "true"); err != nil {
+		t.Fatalf("Could not set -update: %v", err)
+	}
+	t.Cleanup(func() { flag.Set("update", "false") })
+
+	const filename = "testdata/golden_update_fixture.go"
+	markers := packagestest.Markers{}
+	if err := markers.Extract(filename, nil); err != nil {
+		t.Fatalf("Failed to extract markers: %v", err)
+	}
+	want := []byte("updated content\n")
+	markers.Invoke(t, map[string]interface{}{
+		"format": func(g *packagestest.Golden) {
+			g.Check(t, want)
+		},
+	})
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Could not read golden file %v written by -update: %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("-update wrote %q, want %q", got, want)
+	}
+}
+
+func TestExtractAll(t *testing.T) {
+	markers := packagestest.Markers{}
+	if err := markers.ExtractAll("testdata/extractall"); err != nil {
+		t.Fatalf("Failed to extract markers: %v", err)
+	}
+	anchors := markers.Anchors(t)
+	for _, name := range []string{"ModuleMarker", "SourceMarker"} {
+		if _, found := anchors[name]; !found {
+			t.Errorf("Expected anchor %s is missing", name)
+		}
+	}
+}
+
+func TestRegisterLineComment(t *testing.T) {
+	// testdata/registerlinecomment/fixture.ini uses a ";" line comment,
+	// which neither Extract nor ExtractAll recognize until it is
+	// registered here.
+	packagestest.RegisterLineComment(".ini", ";")
+
+	t.Run("Extract", func(t *testing.T) {
+		markers := packagestest.Markers{}
+		if err := markers.Extract("testdata/registerlinecomment/fixture.ini", nil); err != nil {
+			t.Fatalf("Failed to extract markers: %v", err)
+		}
+		if _, found := markers.Anchors(t)["IniMarker"]; !found {
+			t.Errorf("Expected anchor IniMarker is missing")
+		}
+	})
+
+	t.Run("ExtractAll", func(t *testing.T) {
+		markers := packagestest.Markers{}
+		if err := markers.ExtractAll("testdata/registerlinecomment"); err != nil {
+			t.Fatalf("Failed to extract markers: %v", err)
+		}
+		anchors := markers.Anchors(t)
+		for _, name := range []string{"IniMarker", "GoMarker"} {
+			if _, found := anchors[name]; !found {
+				t.Errorf("Expected anchor %s is missing", name)
+			}
+		}
+	})
+}
@@ -0,0 +1,9 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crossfile
+
+//@record("A")
+
+func FuncA() {} //@mark(AnchorA, "FuncA")
@@ -0,0 +1,10 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package crossfile
+
+//@checkCross("FromB", a.AnchorA)
+//@record("B")
+
+func FuncB() {} //@mark(AnchorB, "FuncB")
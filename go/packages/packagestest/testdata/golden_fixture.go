@@ -0,0 +1,14 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fake1
+
+// This file exercises the Golden marker parameter type: format gofmt's
+// this file and checks the result against the named golden fixture.
+
+//@format("greeting.golden")
+
+func greet(name string) string {
+	return "Hello, " + name
+}
@@ -0,0 +1,13 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fake2
+
+// This file exists only to drive TestGoldenMismatch: its golden fixture is
+// checked in with content that never matches what the test passes to
+// Golden.Check, so the mismatch path gets exercised.
+
+//@format("mismatch.golden")
+
+func unused() {}
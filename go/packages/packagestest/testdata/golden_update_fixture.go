@@ -0,0 +1,13 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fake3
+
+// This file exists only to drive TestGoldenUpdate, which runs with -update
+// set and checks that Golden.Check rewrites this golden fixture rather
+// than comparing against it.
+
+//@format("update.golden")
+
+func unused() {}
@@ -0,0 +1,23 @@
+// Copyright 2018 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fake1
+
+// This file exercises the extra marker parameter types supported by
+// buildConverter beyond string, int and Position.
+
+//@printBool("Flag", true)
+//@printFloat("Pi", 3.14)
+//@printDuration("Timeout", "1500ms")
+//@printWords("Words", []string{"un", "deux", "trois"})
+//@printPattern("Greeting", `Hello.*`)
+//@printWordsThenBool("WordsThenFlag", []string{"un", "deux"}, true)
+
+func someTypedFunc() {
+	First := 1  //@First
+	Second := 2 //@Second //@printRange("PatternRange", `Second := 2`)
+	_, _ = First, Second
+}
+
+//@printRange("ExplicitRange", span(First, Second))